@@ -0,0 +1,158 @@
+// Copyright 2018 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/vicanso/elton"
+)
+
+// OverflowPolicy decides what happens when the async buffer is full
+type OverflowPolicy int
+
+const (
+	// OverflowDrop drops the new entry (default)
+	OverflowDrop OverflowPolicy = iota
+	// OverflowBlock blocks the request goroutine until buffer space frees up
+	OverflowBlock
+	// OverflowDropOldest drops the oldest buffered entry to make room for the new one
+	OverflowDropOldest
+)
+
+// logEntry is what gets queued for async dispatch
+type logEntry struct {
+	str    string
+	fields map[string]interface{}
+	c      *elton.Context
+}
+
+// Logger is the middleware returned by New. When Config.BufferSize is 0 it
+// dispatches OnLog/OnLogFields synchronously, same as before; otherwise
+// dispatch happens on a background goroutine fed by a bounded channel
+type Logger struct {
+	handle       elton.Handler
+	onLog        OnLog
+	onLogFields  OnLogFields
+	errorHandler func(error)
+	overflow     OverflowPolicy
+	queue        chan logEntry
+	done         chan struct{}
+	dropped      uint64
+
+	// closeMu serializes enqueue against Close: enqueue holds it for read
+	// for the duration of its send, Close takes it for write before closing
+	// queue, so a send can never race a close on the same channel
+	closeMu sync.RWMutex
+	closed  bool
+}
+
+// Handle is the elton.Handler to mount, e.g. e.Use(lg.Handle)
+func (l *Logger) Handle(c *elton.Context) error {
+	return l.handle(c)
+}
+
+// Dropped returns the number of log entries dropped because the async
+// buffer was full or the Logger was already closed (always 0 when
+// BufferSize is 0)
+func (l *Logger) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+// Close flushes pending entries, waiting until ctx is done at the latest.
+// It is a no-op when async dispatch isn't enabled
+func (l *Logger) Close(ctx context.Context) error {
+	if l.queue == nil {
+		return nil
+	}
+	l.closeMu.Lock()
+	alreadyClosed := l.closed
+	l.closed = true
+	if !alreadyClosed {
+		close(l.queue)
+	}
+	l.closeMu.Unlock()
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dispatch invokes onLog/onLogFields for entry, recovering sink panics into
+// ErrorHandler so one bad entry can't take down the dispatch goroutine
+func (l *Logger) dispatch(entry logEntry) {
+	defer func() {
+		if r := recover(); r != nil && l.errorHandler != nil {
+			l.errorHandler(fmt.Errorf("logger sink panic: %v", r))
+		}
+	}()
+	if entry.str != "" && l.onLog != nil {
+		l.onLog(entry.str, entry.c)
+	}
+	if entry.fields != nil && l.onLogFields != nil {
+		l.onLogFields(entry.fields, entry.c)
+	}
+}
+
+// run drains the queue on a background goroutine until it is closed
+func (l *Logger) run() {
+	defer close(l.done)
+	for entry := range l.queue {
+		l.dispatch(entry)
+	}
+}
+
+// enqueue buffers entry according to the configured OverflowPolicy,
+// incrementing the dropped counter whenever an entry doesn't fit. Held
+// under closeMu's read lock so it can never send on a channel Close is
+// concurrently closing
+func (l *Logger) enqueue(entry logEntry) {
+	l.closeMu.RLock()
+	defer l.closeMu.RUnlock()
+	if l.closed {
+		atomic.AddUint64(&l.dropped, 1)
+		return
+	}
+	switch l.overflow {
+	case OverflowBlock:
+		l.queue <- entry
+	case OverflowDropOldest:
+		select {
+		case l.queue <- entry:
+		default:
+			select {
+			case <-l.queue:
+				atomic.AddUint64(&l.dropped, 1)
+			default:
+			}
+			select {
+			case l.queue <- entry:
+			default:
+				atomic.AddUint64(&l.dropped, 1)
+			}
+		}
+	default:
+		select {
+		case l.queue <- entry:
+		default:
+			atomic.AddUint64(&l.dropped, 1)
+		}
+	}
+}
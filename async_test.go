@@ -0,0 +1,153 @@
+// Copyright 2018 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vicanso/elton"
+)
+
+// TestLoggerCloseRaceWithEnqueue ensures Close never races a concurrent
+// enqueue send on the same channel; run with -race to catch a regression
+func TestLoggerCloseRaceWithEnqueue(t *testing.T) {
+	l := &Logger{
+		queue: make(chan logEntry, 1),
+		done:  make(chan struct{}),
+		onLog: OnLog(func(string, *elton.Context) {}),
+	}
+	go l.run()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				l.enqueue(logEntry{str: "x"})
+			}
+		}
+	}()
+
+	time.Sleep(time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := l.Close(ctx); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+
+	// enqueue after Close must keep dropping, not panic
+	l.enqueue(logEntry{str: "y"})
+	if got := l.Dropped(); got == 0 {
+		t.Errorf("Dropped() = %d, want > 0 after Close", got)
+	}
+}
+
+// TestEnqueueOverflowDrop confirms the default policy drops the newest
+// entry, rather than blocking, once the buffer is full
+func TestEnqueueOverflowDrop(t *testing.T) {
+	l := &Logger{
+		queue:    make(chan logEntry, 1),
+		overflow: OverflowDrop,
+	}
+	l.enqueue(logEntry{str: "a"})
+	l.enqueue(logEntry{str: "b"})
+	if got := l.Dropped(); got != 1 {
+		t.Fatalf("Dropped() = %d, want 1", got)
+	}
+	kept := <-l.queue
+	if kept.str != "a" {
+		t.Errorf("kept entry = %q, want %q (oldest, unchanged)", kept.str, "a")
+	}
+}
+
+// TestEnqueueOverflowDropOldest confirms the newest entry replaces the
+// oldest once the buffer is full, rather than being dropped itself
+func TestEnqueueOverflowDropOldest(t *testing.T) {
+	l := &Logger{
+		queue:    make(chan logEntry, 1),
+		overflow: OverflowDropOldest,
+	}
+	l.enqueue(logEntry{str: "a"})
+	l.enqueue(logEntry{str: "b"})
+	if got := l.Dropped(); got != 1 {
+		t.Fatalf("Dropped() = %d, want 1 (oldest entry dropped to make room)", got)
+	}
+	kept := <-l.queue
+	if kept.str != "b" {
+		t.Errorf("kept entry = %q, want %q (newest)", kept.str, "b")
+	}
+}
+
+// TestEnqueueOverflowBlock confirms the send blocks until buffer space
+// frees up, rather than dropping
+func TestEnqueueOverflowBlock(t *testing.T) {
+	l := &Logger{
+		queue:    make(chan logEntry, 1),
+		overflow: OverflowBlock,
+	}
+	l.enqueue(logEntry{str: "a"})
+
+	done := make(chan struct{})
+	go func() {
+		l.enqueue(logEntry{str: "b"})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("enqueue returned before buffer space freed up")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	<-l.queue // free up space for the blocked send
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("blocked enqueue never completed once space freed up")
+	}
+	if got := l.Dropped(); got != 0 {
+		t.Errorf("Dropped() = %d, want 0 (blocking policy never drops)", got)
+	}
+}
+
+// TestDispatchRecoversSinkPanic ensures a panicking OnLog is recovered and
+// reported via ErrorHandler instead of taking down the dispatch goroutine
+func TestDispatchRecoversSinkPanic(t *testing.T) {
+	var reported error
+	l := &Logger{
+		onLog: OnLog(func(string, *elton.Context) {
+			panic("boom")
+		}),
+		errorHandler: func(err error) {
+			reported = err
+		},
+	}
+
+	l.dispatch(logEntry{str: "x"})
+
+	if reported == nil {
+		t.Fatal("ErrorHandler was not called for a panicking sink")
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/vicanso/elton"
+)
+
+// isBinaryContentType reports whether a Content-Type looks non-textual, in
+// which case body capture is skipped entirely
+func isBinaryContentType(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	switch {
+	case ct == "":
+		return false
+	case strings.HasPrefix(ct, "text/"):
+		return false
+	case strings.Contains(ct, "json"):
+		return false
+	case strings.Contains(ct, "xml"):
+		return false
+	case strings.Contains(ct, "form-urlencoded"):
+		return false
+	default:
+		return true
+	}
+}
+
+// captureBody returns body as a string, or "" when it's binary content or
+// exceeds limit bytes (capture is skipped entirely rather than truncated,
+// so logs never show a body that looks complete but was cut short)
+func captureBody(body []byte, contentType string, limit int) string {
+	if len(body) == 0 || isBinaryContentType(contentType) {
+		return ""
+	}
+	if limit > 0 && len(body) > limit {
+		return ""
+	}
+	return string(body)
+}
+
+// responseBody returns the raw captured response body, or nil when nothing
+// was buffered for this request
+func responseBody(c *elton.Context) []byte {
+	if c.BodyBuffer == nil {
+		return nil
+	}
+	return c.BodyBuffer.Bytes()
+}
+
+// requestBodyJSONCacheKey and responseBodyJSONCacheKey stash a request's
+// resolved {*-body-json:path} values under c.Set, keyed by path, so several
+// tags referencing the same path on the same body only walk it once
+const (
+	requestBodyJSONCacheKey  = "logger-request-body-json"
+	responseBodyJSONCacheKey = "logger-response-body-json"
+)
+
+// jsonPathValue resolves a dot-separated path (e.g. "user.id" or
+// "items.0.name") against body using a streaming json.Decoder, so a large
+// body is walked straight to the requested field instead of being
+// unmarshalled into a generic tree first. Results are cached per path under
+// cacheKey on c so repeat tags for the same path don't re-walk the body
+func jsonPathValue(c *elton.Context, cacheKey string, body []byte, path string) string {
+	if len(body) == 0 || path == "" {
+		return ""
+	}
+	cache, _ := c.Get(cacheKey)
+	paths, _ := cache.(map[string]string)
+	if v, ok := paths[path]; ok {
+		return v
+	}
+
+	value := ""
+	if raw, ok := findJSONPath(body, strings.Split(path, ".")); ok {
+		value = formatJSONRaw(raw)
+	}
+
+	if paths == nil {
+		paths = make(map[string]string)
+	}
+	paths[path] = value
+	c.Set(cacheKey, paths)
+	return value
+}
+
+// findJSONPath walks body's tokens to the value at steps, discarding each
+// sibling field as it passes it, and returns that value's raw encoding
+func findJSONPath(body []byte, steps []string) (json.RawMessage, bool) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	return decodeJSONPath(dec, steps)
+}
+
+// decodeJSONPath consumes dec's current value: once steps is empty, it
+// decodes and returns that value's raw encoding; otherwise it must be an
+// object or array, and every sibling that isn't on the path is discarded
+// with a throwaway Decode rather than being kept around
+func decodeJSONPath(dec *json.Decoder, steps []string) (json.RawMessage, bool) {
+	if len(steps) == 0 {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, false
+		}
+		return raw, true
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, false
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return nil, false
+	}
+
+	switch delim {
+	case '{':
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, false
+			}
+			key, _ := keyTok.(string)
+			if key == steps[0] {
+				return decodeJSONPath(dec, steps[1:])
+			}
+			var discard json.RawMessage
+			if err := dec.Decode(&discard); err != nil {
+				return nil, false
+			}
+		}
+	case '[':
+		idx, err := strconv.Atoi(steps[0])
+		if err != nil {
+			return nil, false
+		}
+		for i := 0; dec.More(); i++ {
+			if i == idx {
+				return decodeJSONPath(dec, steps[1:])
+			}
+			var discard json.RawMessage
+			if err := dec.Decode(&discard); err != nil {
+				return nil, false
+			}
+		}
+	}
+	return nil, false
+}
+
+// formatJSONRaw renders a raw JSON value as a plain string: quotes are
+// stripped from strings, "null" becomes "", everything else (numbers,
+// bools, objects, arrays) is returned as its literal JSON text
+func formatJSONRaw(raw json.RawMessage) string {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || string(trimmed) == "null" {
+		return ""
+	}
+	if trimmed[0] == '"' {
+		var s string
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return ""
+		}
+		return s
+	}
+	return string(trimmed)
+}
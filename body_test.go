@@ -0,0 +1,103 @@
+// Copyright 2018 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"testing"
+
+	"github.com/vicanso/elton"
+)
+
+func TestJSONPathValueCachesParse(t *testing.T) {
+	c := &elton.Context{}
+	body := []byte(`{"user":{"id":42,"name":"ann"}}`)
+
+	if got := jsonPathValue(c, requestBodyJSONCacheKey, body, "user.id"); got != "42" {
+		t.Fatalf("user.id = %q, want 42", got)
+	}
+	if got := jsonPathValue(c, requestBodyJSONCacheKey, body, "user.name"); got != "ann" {
+		t.Fatalf("user.name = %q, want ann", got)
+	}
+
+	// a different body under the same cache key must not be re-parsed,
+	// proving the value cached by the first lookup of this path is reused
+	corrupted := []byte("not json")
+	if got := jsonPathValue(c, requestBodyJSONCacheKey, corrupted, "user.id"); got != "42" {
+		t.Fatalf("cached user.id = %q, want 42 (cache not reused)", got)
+	}
+}
+
+func TestJSONPathValueArrayIndexAndNestedLeaf(t *testing.T) {
+	c := &elton.Context{}
+	body := []byte(`{"items":[{"name":"a"},{"name":"b","meta":{"tag":"x"}}]}`)
+
+	if got := jsonPathValue(c, requestBodyJSONCacheKey, body, "items.1.name"); got != "b" {
+		t.Errorf("items.1.name = %q, want b", got)
+	}
+	if got := jsonPathValue(c, requestBodyJSONCacheKey, body, "items.1.meta"); got != `{"tag":"x"}` {
+		t.Errorf("items.1.meta = %q, want raw nested object", got)
+	}
+	if got := jsonPathValue(c, requestBodyJSONCacheKey, body, "items.5.name"); got != "" {
+		t.Errorf("out of range index = %q, want empty", got)
+	}
+}
+
+func TestJSONPathValueInvalidJSON(t *testing.T) {
+	c := &elton.Context{}
+	if got := jsonPathValue(c, requestBodyJSONCacheKey, []byte("not json"), "a"); got != "" {
+		t.Fatalf("got %q, want empty string on invalid JSON", got)
+	}
+}
+
+func TestIsBinaryContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"", false},
+		{"text/plain", false},
+		{"application/json", false},
+		{"application/json; charset=utf-8", false},
+		{"application/xml", false},
+		{"application/x-www-form-urlencoded", false},
+		{"image/png", true},
+		{"application/octet-stream", true},
+		{"multipart/form-data; boundary=x", true},
+	}
+	for _, tt := range tests {
+		if got := isBinaryContentType(tt.contentType); got != tt.want {
+			t.Errorf("isBinaryContentType(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestCaptureBodySkipsBinaryContentType(t *testing.T) {
+	if got := captureBody([]byte{0x00, 0x01}, "application/octet-stream", 0); got != "" {
+		t.Errorf("captureBody = %q, want empty for binary content type", got)
+	}
+}
+
+func TestCaptureBodySkipsOverLimit(t *testing.T) {
+	body := []byte(`{"a":1}`)
+	if got := captureBody(body, "application/json", len(body)-1); got != "" {
+		t.Errorf("captureBody = %q, want empty when body exceeds limit", got)
+	}
+	if got := captureBody(body, "application/json", len(body)); got != string(body) {
+		t.Errorf("captureBody = %q, want %q when body is within limit", got, body)
+	}
+	if got := captureBody(body, "application/json", 0); got != string(body) {
+		t.Errorf("captureBody = %q, want %q when limit is 0 (unlimited)", got, body)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/vicanso/elton"
+)
+
+type (
+	// FieldSpec defines a structured log field. Tag is a single template
+	// expression such as "{latency-ms}", "{>X-Request-Id}" or "{~session}".
+	// Name is the key used in the resulting fields map, defaulting to
+	// "category:param" (e.g. "latency-ms", "requestHeader:X-Request-Id")
+	// when empty.
+	FieldSpec struct {
+		Name string
+		Tag  string
+	}
+	// OnLogFields on log function for structured (map based) output
+	OnLogFields func(fields map[string]interface{}, c *elton.Context)
+
+	field struct {
+		name string
+		tag  *Tag
+	}
+)
+
+// defaultFieldName names a field with no explicit FieldSpec.Name, combining
+// category and parameter (e.g. "requestHeader:X-Request-Id", "cookie:sess",
+// "context:tenant") so two parameterized tags of the same category - two
+// headers, two cookies, two context keys - don't collapse onto one map key
+func defaultFieldName(tag *Tag) string {
+	if tag.data == "" {
+		return tag.category
+	}
+	return tag.category + ":" + tag.data
+}
+
+// parseFields pre-parses each FieldSpec's Tag into a single Tag, panicking
+// if a spec does not resolve to exactly one tag or if two specs resolve to
+// the same field name
+func parseFields(specs []FieldSpec) []*field {
+	if len(specs) == 0 {
+		return nil
+	}
+	arr := make([]*field, len(specs))
+	seen := make(map[string]bool, len(specs))
+	for i, spec := range specs {
+		tags := parse([]byte(spec.Tag))
+		if len(tags) != 1 {
+			panic("logger field tag must resolve to exactly one tag: " + spec.Tag)
+		}
+		name := spec.Name
+		if name == "" {
+			name = defaultFieldName(tags[0])
+		}
+		if seen[name] {
+			panic("logger: duplicate field name " + name + ", set FieldSpec.Name to disambiguate")
+		}
+		seen[name] = true
+		arr[i] = &field{
+			name: name,
+			tag:  tags[0],
+		}
+	}
+	return arr
+}
+
+// typedTagValue converts a tag's raw string value to a more specific type
+// (int for latency/size/status style tags) so structured log consumers
+// (JSON, etc.) don't need to parse strings back into numbers
+func typedTagValue(tag *Tag, raw string) interface{} {
+	switch tag.category {
+	case latencyMs, size, payloadSize, status:
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return raw
+		}
+		return v
+	default:
+		return raw
+	}
+}
+
+// buildFields builds a map of field name to typed value for the pre-parsed fields
+func buildFields(c *elton.Context, fields []*field, startedAt time.Time, config *Config) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		raw := tagValue(c, f.tag, startedAt, config)
+		m[f.name] = typedTagValue(f.tag, raw)
+	}
+	return m
+}
+
+// JSONOnLogFields adapts a legacy string-based OnLog to OnLogFields by
+// marshalling the fields map to JSON, so existing sinks can be reused
+// while callers migrate to Config.Fields
+func JSONOnLogFields(onLog OnLog) OnLogFields {
+	return func(fields map[string]interface{}, c *elton.Context) {
+		buf, err := json.Marshal(fields)
+		if err != nil {
+			return
+		}
+		onLog(byteSliceToString(buf), c)
+	}
+}
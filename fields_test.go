@@ -0,0 +1,76 @@
+// Copyright 2018 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vicanso/elton"
+)
+
+func TestParseFieldsDefaultNameDisambiguatesHeaders(t *testing.T) {
+	fields := parseFields([]FieldSpec{
+		{Tag: "{>X-Request-Id}"},
+		{Tag: "{>X-User-Id}"},
+	})
+	if len(fields) != 2 {
+		t.Fatalf("got %d fields, want 2", len(fields))
+	}
+	if fields[0].name == fields[1].name {
+		t.Fatalf("both fields named %q, want distinct names", fields[0].name)
+	}
+}
+
+func TestParseFieldsPanicsOnDuplicateName(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("parseFields did not panic for duplicate field names")
+		}
+	}()
+	parseFields([]FieldSpec{
+		{Name: "dup", Tag: "{method}"},
+		{Name: "dup", Tag: "{path}"},
+	})
+}
+
+func TestBuildFieldsHeadersCookiesAndContext(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	req.Header.Set("X-User-Id", "user-1")
+	c := &elton.Context{Request: req}
+	c.Set("tenant", "acme")
+
+	fields := parseFields([]FieldSpec{
+		{Tag: "{>X-Request-Id}"},
+		{Tag: "{>X-User-Id}"},
+		{Tag: "{context:tenant}"},
+	})
+	got := buildFields(c, fields, time.Now(), nil)
+	want := map[string]interface{}{
+		"requestHeader:X-Request-Id": "req-1",
+		"requestHeader:X-User-Id":    "user-1",
+		"context:tenant":             "acme",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("fields[%q] = %v, want %v", k, got[k], v)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d fields, want %d: %v", len(got), len(want), got)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import "github.com/vicanso/elton"
+
+// defaultFormatKey is the Formats key Config.Format shortcuts to, and the
+// key Selector falls back on when it returns an unknown name
+const defaultFormatKey = "default"
+
+// Selector picks which of Config.Formats' parsed templates to use for a
+// request, e.g. routing /admin/* to a verbose format and /healthz to a
+// minimal one without stacking multiple copies of the middleware
+type Selector func(c *elton.Context) string
+
+// parseFormats pre-parses config.Format (as the "default" key) and every
+// entry of config.Formats into Tag slices, once, up front
+func parseFormats(format string, formats map[string]string) map[string][]*Tag {
+	if format == "" && len(formats) == 0 {
+		return nil
+	}
+	tagsByName := make(map[string][]*Tag, len(formats)+1)
+	if format != "" {
+		tagsByName[defaultFormatKey] = parse([]byte(format))
+	}
+	for name, f := range formats {
+		tagsByName[name] = parse([]byte(f))
+	}
+	return tagsByName
+}
+
+// selectTags resolves the Tag slice to use for c, falling back to the
+// "default" format when selector picks an unconfigured name
+func selectTags(tagsByName map[string][]*Tag, selector Selector, c *elton.Context) []*Tag {
+	name := defaultFormatKey
+	if selector != nil {
+		name = selector(c)
+	}
+	if tags, ok := tagsByName[name]; ok {
+		return tags
+	}
+	return tagsByName[defaultFormatKey]
+}
@@ -0,0 +1,47 @@
+// Copyright 2018 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"testing"
+
+	"github.com/vicanso/elton"
+)
+
+func TestNewPanicsWithoutDefaultFormat(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("New did not panic for Formats without a \"default\" entry")
+		}
+	}()
+	New(Config{
+		Formats: map[string]string{
+			"admin": "{method} {uri}",
+		},
+		Selector: func(*elton.Context) string { return "admin" },
+		OnLog:    func(string, *elton.Context) {},
+	})
+}
+
+func TestSelectTagsFallsBackToDefault(t *testing.T) {
+	tagsByName := parseFormats("{method}", map[string]string{
+		"admin": "{method} {uri}",
+	})
+	got := selectTags(tagsByName, func(*elton.Context) string { return "unknown" }, &elton.Context{})
+	want := tagsByName[defaultFormatKey]
+	if len(got) != len(want) {
+		t.Fatalf("selectTags fallback = %v, want %v", got, want)
+	}
+}
@@ -15,6 +15,7 @@
 package logger
 
 import (
+	"bytes"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -56,11 +57,28 @@ const (
 	httpProto        = "HTTP"
 	httpsProto       = "HTTPS"
 
+	traceID          = "trace-id"
+	spanID           = "span-id"
+	traceFlags       = "trace-flags"
+	contextTag       = "context"
+	contextTagPrefix = "context:"
+
+	requestBodyTag      = "request-body"
+	requestBodyJSONTag  = "request-body-json"
+	responseBodyTag     = "response-body"
+	responseBodyJSONTag = "response-body-json"
+
+	requestBodyJSONPrefix  = "request-body-json:"
+	responseBodyJSONPrefix = "response-body-json:"
+
 	kbytes = 1024
 	mbytes = 1024 * 1024
 
 	// CommonFormat common log format
 	CommonFormat = "{real-ip} {when-iso} {method} {uri} {status}"
+	// TraceFormat common log format with trace correlation and a custom
+	// context field appended, e.g. "... {trace-id} {span-id} {context:userId}"
+	TraceFormat = CommonFormat + " {trace-id} {span-id} {context:userId}"
 )
 
 type (
@@ -73,12 +91,81 @@ type (
 	OnLog func(string, *elton.Context)
 	// Config logger config
 	Config struct {
-		Format  string
-		OnLog   OnLog
-		Skipper elton.Skipper
+		// Format is a shortcut for Formats["default"], kept for backward
+		// compatibility; Formats takes precedence for the "default" key
+		Format string
+		// Formats named, pre-parsed templates; Selector picks which one
+		// applies to a given request, defaulting to the "default" key
+		Formats map[string]string
+		// Selector picks the Formats key to use per request; nil always
+		// selects "default"
+		Selector Selector
+		OnLog    OnLog
+		Skipper  elton.Skipper
+
+		// Fields structured fields to build for OnLogFields, each one
+		// resolves a single template tag (e.g. "{latency-ms}") to a map entry
+		Fields []FieldSpec
+		// OnLogFields on log function for structured (map based) output,
+		// called alongside OnLog when Fields is configured
+		OnLogFields OnLogFields
+
+		// Sampler decides whether a request is logged, skipped entirely
+		// (no OnLog/OnLogFields call) when it returns false
+		Sampler Sampler
+
+		// TraceHeader request header used to resolve {trace-id} when neither
+		// an active otel span nor a W3C traceparent header is present
+		TraceHeader string
+
+		// BufferSize enables async log dispatch on a background goroutine fed
+		// by a channel of this size; 0 (default) keeps dispatch synchronous
+		BufferSize int
+		// OverflowPolicy what to do when the async buffer is full
+		OverflowPolicy OverflowPolicy
+		// ErrorHandler receives sink failures (panics recovered from
+		// OnLog/OnLogFields), for both sync and async dispatch
+		ErrorHandler func(error)
+
+		// BodyLimit caps how many bytes of a request/response body are
+		// captured by the {request-body}/{response-body} tags: a larger body
+		// is not captured at all rather than truncated; 0 means unlimited.
+		// {request-body-json:path}/{response-body-json:path} ignore it
+		BodyLimit int
+		// Redactor scrubs PII from a tag's resolved value before it's written
+		// to the log, e.g. masking password/token/authorization values.
+		// field is the tag's header/cookie/context/jsonpath name, or its
+		// category (e.g. "request-body") for tags without one
+		Redactor func(field string, value string) string
 	}
 )
 
+// traceHeader returns the configured trace header, tolerating a nil config
+func traceHeader(config *Config) string {
+	if config == nil {
+		return ""
+	}
+	return config.TraceHeader
+}
+
+// bodyLimit returns the configured body limit, tolerating a nil config
+func bodyLimit(config *Config) int {
+	if config == nil {
+		return 0
+	}
+	return config.BodyLimit
+}
+
+// redactField names the field passed to Config.Redactor for a tag
+func redactField(tag *Tag) string {
+	switch tag.category {
+	case requestHeader, responseHeader, cookie, contextTag, requestBodyJSONTag, responseBodyJSONTag:
+		return tag.data
+	default:
+		return tag.category
+	}
+}
+
 // byteSliceToString converts a []byte to string without a heap allocation.
 func byteSliceToString(b []byte) string {
 	return *(*string)(unsafe.Pointer(&b))
@@ -137,6 +224,30 @@ func parse(desc []byte) []*Tag {
 			})
 		}
 		k := desc[start+1 : end-1]
+		if bytes.HasPrefix(k, []byte(contextTagPrefix)) {
+			arr = append(arr, &Tag{
+				category: contextTag,
+				data:     byteSliceToString(k[len(contextTagPrefix):]),
+			})
+			index = result[1] + index
+			continue
+		}
+		if bytes.HasPrefix(k, []byte(requestBodyJSONPrefix)) {
+			arr = append(arr, &Tag{
+				category: requestBodyJSONTag,
+				data:     byteSliceToString(k[len(requestBodyJSONPrefix):]),
+			})
+			index = result[1] + index
+			continue
+		}
+		if bytes.HasPrefix(k, []byte(responseBodyJSONPrefix)) {
+			arr = append(arr, &Tag{
+				category: responseBodyJSONTag,
+				data:     byteSliceToString(k[len(responseBodyJSONPrefix):]),
+			})
+			index = result[1] + index
+			continue
+		}
 		switch k[0] {
 		case byte('~'):
 			arr = append(arr, &Tag{
@@ -170,92 +281,121 @@ func parse(desc []byte) []*Tag {
 	return arr
 }
 
-// format 格式化访问日志信息
-func format(c *elton.Context, tags []*Tag, startedAt time.Time) string {
-	fn := func(tag *Tag) string {
-		switch tag.category {
-		case host:
-			return c.Request.Host
-		case method:
-			return c.Request.Method
-		case path:
-			p := c.Request.URL.Path
-			if p == "" {
-				p = "/"
-			}
-			return p
-		case proto:
-			return c.Request.Proto
-		case query:
-			return c.Request.URL.RawQuery
-		case remote:
-			return c.Request.RemoteAddr
-		case realIP:
-			return c.RealIP()
-		case scheme:
-			if c.Request.TLS != nil {
-				return httpsProto
-			}
-			return httpProto
-		case uri:
-			return c.Request.RequestURI
-		case cookie:
-			cookie, err := c.Cookie(tag.data)
-			if err != nil {
-				return ""
-			}
-			return cookie.Value
-		case requestHeader:
-			return c.Request.Header.Get(tag.data)
-		case responseHeader:
-			return c.GetHeader(tag.data)
-		case referer:
-			return c.Request.Referer()
-		case userAgent:
-			return c.Request.UserAgent()
-		case when:
-			return time.Now().Format(time.RFC1123Z)
-		case whenISO:
-			return time.Now().Format(time.RFC3339)
-		case whenUTCISO:
-			return time.Now().UTC().Format("2006-01-02T15:04:05Z")
-		case whenISOMs:
-			return time.Now().Format("2006-01-02T15:04:05.999Z07:00")
-		case whenUTCISOMs:
-			return time.Now().UTC().Format("2006-01-02T15:04:05.999Z")
-		case whenUnix:
-			return strconv.FormatInt(time.Now().Unix(), 10)
-		case status:
-			return strconv.Itoa(c.StatusCode)
-		case payloadSize:
-			return strconv.Itoa(len(c.RequestBody))
-		case payloadSizeHuman:
-			return getHumanReadableSize(len(c.RequestBody))
-		case size:
-			bodyBuf := c.BodyBuffer
-			if bodyBuf == nil {
-				return "0"
-			}
-			return strconv.Itoa(bodyBuf.Len())
-		case sizeHuman:
-			bodyBuf := c.BodyBuffer
-			if bodyBuf == nil {
-				return "0B"
-			}
-			return getHumanReadableSize(bodyBuf.Len())
-		case latency:
-			return time.Since(startedAt).String()
-		case latencyMs:
-			ms := getTimeConsuming(startedAt)
-			return strconv.Itoa(ms)
-		default:
-			return tag.data
+// tagValue 获取单个tag对应的值
+func tagValue(c *elton.Context, tag *Tag, startedAt time.Time, config *Config) string {
+	v := rawTagValue(c, tag, startedAt, config)
+	if config != nil && config.Redactor != nil {
+		return config.Redactor(redactField(tag), v)
+	}
+	return v
+}
+
+// rawTagValue computes a tag's value before redaction
+func rawTagValue(c *elton.Context, tag *Tag, startedAt time.Time, config *Config) string {
+	switch tag.category {
+	case requestBodyTag:
+		return captureBody(c.RequestBody, c.Request.Header.Get("Content-Type"), bodyLimit(config))
+	case requestBodyJSONTag:
+		return jsonPathValue(c, requestBodyJSONCacheKey, c.RequestBody, tag.data)
+	case responseBodyTag:
+		return captureBody(responseBody(c), c.GetHeader("Content-Type"), bodyLimit(config))
+	case responseBodyJSONTag:
+		return jsonPathValue(c, responseBodyJSONCacheKey, responseBody(c), tag.data)
+	case traceID, spanID, traceFlags:
+		return resolveTrace(c, tag.category, traceHeader(config))
+	case contextTag:
+		v, ok := c.Get(tag.data)
+		if !ok {
+			return ""
+		}
+		if s, ok := v.(string); ok {
+			return s
+		}
+		return fmt.Sprint(v)
+	case host:
+		return c.Request.Host
+	case method:
+		return c.Request.Method
+	case path:
+		p := c.Request.URL.Path
+		if p == "" {
+			p = "/"
+		}
+		return p
+	case proto:
+		return c.Request.Proto
+	case query:
+		return c.Request.URL.RawQuery
+	case remote:
+		return c.Request.RemoteAddr
+	case realIP:
+		return c.RealIP()
+	case scheme:
+		if c.Request.TLS != nil {
+			return httpsProto
+		}
+		return httpProto
+	case uri:
+		return c.Request.RequestURI
+	case cookie:
+		cookie, err := c.Cookie(tag.data)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	case requestHeader:
+		return c.Request.Header.Get(tag.data)
+	case responseHeader:
+		return c.GetHeader(tag.data)
+	case referer:
+		return c.Request.Referer()
+	case userAgent:
+		return c.Request.UserAgent()
+	case when:
+		return time.Now().Format(time.RFC1123Z)
+	case whenISO:
+		return time.Now().Format(time.RFC3339)
+	case whenUTCISO:
+		return time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	case whenISOMs:
+		return time.Now().Format("2006-01-02T15:04:05.999Z07:00")
+	case whenUTCISOMs:
+		return time.Now().UTC().Format("2006-01-02T15:04:05.999Z")
+	case whenUnix:
+		return strconv.FormatInt(time.Now().Unix(), 10)
+	case status:
+		return strconv.Itoa(c.StatusCode)
+	case payloadSize:
+		return strconv.Itoa(len(c.RequestBody))
+	case payloadSizeHuman:
+		return getHumanReadableSize(len(c.RequestBody))
+	case size:
+		bodyBuf := c.BodyBuffer
+		if bodyBuf == nil {
+			return "0"
+		}
+		return strconv.Itoa(bodyBuf.Len())
+	case sizeHuman:
+		bodyBuf := c.BodyBuffer
+		if bodyBuf == nil {
+			return "0B"
 		}
+		return getHumanReadableSize(bodyBuf.Len())
+	case latency:
+		return time.Since(startedAt).String()
+	case latencyMs:
+		ms := getTimeConsuming(startedAt)
+		return strconv.Itoa(ms)
+	default:
+		return tag.data
 	}
+}
 
+// format 格式化访问日志信息
+func format(c *elton.Context, tags []*Tag, startedAt time.Time, config *Config) string {
 	arr := make([]string, 0, len(tags))
 	for _, tag := range tags {
-		arr = append(arr, fn(tag))
+		arr = append(arr, tagValue(c, tag, startedAt, config))
 	}
 	return strings.Join(arr, "")
 }
@@ -264,31 +404,83 @@ func format(c *elton.Context, tags []*Tag, startedAt time.Time) string {
 func GenerateLog(layout string) func(*elton.Context, time.Time) string {
 	tags := parse([]byte(layout))
 	return func(c *elton.Context, startedAt time.Time) string {
-		return format(c, tags, startedAt)
+		return format(c, tags, startedAt, nil)
 	}
 }
 
-// New create a logger middleware
-func New(config Config) elton.Handler {
-	if config.Format == "" {
-		panic("logger require format")
+// New creates a logger middleware. It returns a *Logger rather than a bare
+// elton.Handler so that async dispatch (Config.BufferSize) can be flushed
+// with Close at shutdown; mount it with e.Use(lg.Handle)
+func New(config Config) *Logger {
+	hasFormat := config.Format != "" || len(config.Formats) != 0
+	if !hasFormat && len(config.Fields) == 0 {
+		panic("logger require format or fields")
 	}
-	if config.OnLog == nil {
+	if hasFormat && config.OnLog == nil {
 		panic("logger require on log function")
 	}
-	tags := parse([]byte(config.Format))
+	if len(config.Fields) != 0 && config.OnLogFields == nil {
+		panic("logger require on log fields function")
+	}
+	tagsByName := parseFormats(config.Format, config.Formats)
+	if hasFormat && tagsByName[defaultFormatKey] == nil {
+		panic(`logger require a "default" format: set Config.Format or include a "default" entry in Config.Formats`)
+	}
+	fields := parseFields(config.Fields)
 	skipper := config.Skipper
 	if skipper == nil {
 		skipper = elton.DefaultSkipper
 	}
-	return func(c *elton.Context) (err error) {
+
+	l := &Logger{
+		onLog:        config.OnLog,
+		onLogFields:  config.OnLogFields,
+		errorHandler: config.ErrorHandler,
+		overflow:     config.OverflowPolicy,
+	}
+	if config.BufferSize > 0 {
+		l.queue = make(chan logEntry, config.BufferSize)
+		l.done = make(chan struct{})
+		go l.run()
+	}
+
+	l.handle = func(c *elton.Context) (err error) {
 		if skipper(c) {
 			return c.Next()
 		}
 		startedAt := time.Now()
 		err = c.Next()
-		str := format(c, tags, startedAt)
-		config.OnLog(str, c)
+		if config.Sampler != nil && !config.Sampler.Sample(c, startedAt) {
+			return err
+		}
+		var entry logEntry
+		hasEntry := false
+		if tagsByName != nil {
+			tags := selectTags(tagsByName, config.Selector, c)
+			if tags != nil {
+				entry.str = format(c, tags, startedAt, &config)
+				hasEntry = true
+			}
+		}
+		if len(fields) != 0 {
+			entry.fields = buildFields(c, fields, startedAt, &config)
+			hasEntry = true
+		}
+		if !hasEntry {
+			return err
+		}
+		entry.c = c
+		if l.queue != nil {
+			// c is pooled by elton and gets Reset + handed to another
+			// request as soon as this middleware returns; since the async
+			// dispatch goroutine reads/forwards c after that point, it must
+			// be excluded from the pool for the rest of its lifetime
+			c.DisableReuse()
+			l.enqueue(entry)
+		} else {
+			l.dispatch(entry)
+		}
 		return err
 	}
+	return l
 }
@@ -0,0 +1,135 @@
+// Copyright 2018 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vicanso/elton"
+)
+
+type (
+	// Sampler decides whether the current request should be logged. It is
+	// called after the handler chain completes (so status code and latency
+	// are available) and before OnLog/OnLogFields
+	Sampler interface {
+		Sample(c *elton.Context, startedAt time.Time) bool
+	}
+	// SamplerFunc adapts a plain function to a Sampler
+	SamplerFunc func(c *elton.Context, startedAt time.Time) bool
+)
+
+// Sample calls fn
+func (fn SamplerFunc) Sample(c *elton.Context, startedAt time.Time) bool {
+	return fn(c, startedAt)
+}
+
+// NewFixedSampler returns a Sampler that logs 1 of every n requests
+func NewFixedSampler(n int) Sampler {
+	if n < 1 {
+		n = 1
+	}
+	var counter uint64
+	return SamplerFunc(func(_ *elton.Context, _ time.Time) bool {
+		v := atomic.AddUint64(&counter, 1)
+		return v%uint64(n) == 0
+	})
+}
+
+// NewTailSampler returns a Sampler that logs only requests with a status
+// code >= minStatus or a latency >= minLatency; all other requests are skipped
+func NewTailSampler(minStatus int, minLatency time.Duration) Sampler {
+	return SamplerFunc(func(c *elton.Context, startedAt time.Time) bool {
+		if c.StatusCode >= minStatus {
+			return true
+		}
+		return time.Since(startedAt) >= minLatency
+	})
+}
+
+// tokenBucket is a minimal token bucket, refilled lazily on each allow call
+type tokenBucket struct {
+	mu     sync.Mutex
+	rps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += now.Sub(b.last).Seconds() * b.rps
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// tokenBucketSampler rate limits logging per method+route template, so a hot
+// route can't drown out logs from quieter ones
+type tokenBucketSampler struct {
+	rps     float64
+	burst   float64
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// routeKey builds the method+route template key a request's bucket is keyed by
+func routeKey(c *elton.Context) string {
+	route := c.Route
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	return c.Request.Method + " " + route
+}
+
+func (s *tokenBucketSampler) Sample(c *elton.Context, _ time.Time) bool {
+	key := routeKey(c)
+	s.mu.Lock()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{
+			rps:    s.rps,
+			burst:  s.burst,
+			tokens: s.burst,
+			last:   time.Now(),
+		}
+		s.buckets[key] = b
+	}
+	s.mu.Unlock()
+	return b.allow(time.Now())
+}
+
+// NewTokenBucketSampler returns a Sampler that rate limits log emission to
+// rps requests per second (with burst allowance) for each method+route
+// template, independently
+func NewTokenBucketSampler(rps float64, burst int) Sampler {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucketSampler{
+		rps:     rps,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
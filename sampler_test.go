@@ -0,0 +1,101 @@
+// Copyright 2018 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vicanso/elton"
+)
+
+func TestNewFixedSampler(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		want []bool
+	}{
+		{
+			name: "n of 1 logs every request",
+			n:    1,
+			want: []bool{true, true, true, true},
+		},
+		{
+			name: "n of 3 logs every third request",
+			n:    3,
+			want: []bool{false, false, true, false, false, true},
+		},
+		{
+			name: "n below 1 is clamped to 1",
+			n:    0,
+			want: []bool{true, true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewFixedSampler(tt.n)
+			for i, want := range tt.want {
+				got := s.Sample(nil, time.Time{})
+				if got != want {
+					t.Errorf("call %d: got %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewTailSampler(t *testing.T) {
+	s := NewTailSampler(500, 100*time.Millisecond)
+
+	ok := &elton.Context{StatusCode: 200}
+	if s.Sample(ok, time.Now()) {
+		t.Error("fast, successful request should not be sampled")
+	}
+
+	errStatus := &elton.Context{StatusCode: 500}
+	if !s.Sample(errStatus, time.Now()) {
+		t.Error("request with status >= minStatus should always be sampled")
+	}
+
+	slow := &elton.Context{StatusCode: 200}
+	if !s.Sample(slow, time.Now().Add(-200*time.Millisecond)) {
+		t.Error("request with latency >= minLatency should always be sampled")
+	}
+}
+
+func TestNewTokenBucketSampler(t *testing.T) {
+	s := NewTokenBucketSampler(0, 2)
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	c := &elton.Context{Request: req, Route: "/users"}
+
+	// burst allows the first 2 requests through, rps of 0 means no refill
+	if !s.Sample(c, time.Time{}) {
+		t.Error("1st request within burst should be sampled")
+	}
+	if !s.Sample(c, time.Time{}) {
+		t.Error("2nd request within burst should be sampled")
+	}
+	if s.Sample(c, time.Time{}) {
+		t.Error("3rd request should exhaust the burst and be dropped")
+	}
+
+	// a different method+route template has its own independent bucket
+	other := &elton.Context{Request: httptest.NewRequest(http.MethodPost, "/orders", nil), Route: "/orders"}
+	if !s.Sample(other, time.Time{}) {
+		t.Error("request on a different route should have its own bucket")
+	}
+}
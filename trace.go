@@ -0,0 +1,95 @@
+// Copyright 2018 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"strings"
+
+	"github.com/vicanso/elton"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otelSpanContextKey is the key middleware upstream can use with c.Set to
+// stash an active otel span when it isn't reachable through the request's
+// context.Context (e.g. it was started after the request context was read)
+const otelSpanContextKey = "otel-span"
+
+// traceParent holds the fields of a parsed W3C traceparent header
+// ("version-traceid-spanid-flags")
+type traceParent struct {
+	traceID string
+	spanID  string
+	flags   string
+}
+
+// parseTraceParent parses a W3C traceparent header value, returning
+// ok=false when it doesn't have the expected 4 dash-separated fields
+func parseTraceParent(header string) (traceParent, bool) {
+	parts := strings.Split(header, "-")
+	if len(parts) != 4 {
+		return traceParent{}, false
+	}
+	return traceParent{
+		traceID: parts[1],
+		spanID:  parts[2],
+		flags:   parts[3],
+	}, true
+}
+
+// activeSpanContext returns the otel span context for the request, checking
+// a span stashed via c.Set(otelSpanContextKey, ...) before falling back to
+// the one propagated through the request's context.Context
+func activeSpanContext(c *elton.Context) (trace.SpanContext, bool) {
+	if v, ok := c.Get(otelSpanContextKey); ok {
+		if span, ok := v.(trace.Span); ok && span.SpanContext().IsValid() {
+			return span.SpanContext(), true
+		}
+	}
+	sc := trace.SpanFromContext(c.Request.Context()).SpanContext()
+	if sc.IsValid() {
+		return sc, true
+	}
+	return trace.SpanContext{}, false
+}
+
+// resolveTrace resolves a trace-id/span-id/trace-flags tag, in order: an
+// active otel span, the W3C traceparent request header, and finally
+// traceHeader (e.g. X-Request-Id) as a trace-id-only fallback
+func resolveTrace(c *elton.Context, category, traceHeader string) string {
+	if sc, ok := activeSpanContext(c); ok {
+		switch category {
+		case traceID:
+			return sc.TraceID().String()
+		case spanID:
+			return sc.SpanID().String()
+		case traceFlags:
+			return sc.TraceFlags().String()
+		}
+	}
+	if tp, ok := parseTraceParent(c.Request.Header.Get("traceparent")); ok {
+		switch category {
+		case traceID:
+			return tp.traceID
+		case spanID:
+			return tp.spanID
+		case traceFlags:
+			return tp.flags
+		}
+	}
+	if category == traceID && traceHeader != "" {
+		return c.Request.Header.Get(traceHeader)
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vicanso/elton"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestResolveTracePrefersActiveSpan(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-bbbbbbbbbbbbbbbb-01")
+	req.Header.Set("X-Request-Id", "fallback-id")
+	c := &elton.Context{Request: req}
+
+	spanTraceID, _ := trace.TraceIDFromHex("cccccccccccccccccccccccccccccccc")
+	spanSpanID, _ := trace.SpanIDFromHex("dddddddddddddddd")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    spanTraceID,
+		SpanID:     spanSpanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+	span := trace.SpanFromContext(trace.ContextWithSpanContext(context.Background(), sc))
+	c.Set(otelSpanContextKey, span)
+
+	if got := resolveTrace(c, traceID, "X-Request-Id"); got != spanTraceID.String() {
+		t.Errorf("trace-id = %q, want active span's %q", got, spanTraceID.String())
+	}
+	if got := resolveTrace(c, spanID, "X-Request-Id"); got != spanSpanID.String() {
+		t.Errorf("span-id = %q, want active span's %q", got, spanSpanID.String())
+	}
+}
+
+func TestResolveTraceFallsBackToTraceparentHeader(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-bbbbbbbbbbbbbbbb-01")
+	req.Header.Set("X-Request-Id", "fallback-id")
+	c := &elton.Context{Request: req}
+
+	if got := resolveTrace(c, traceID, "X-Request-Id"); got != "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" {
+		t.Errorf("trace-id = %q, want traceparent's trace id", got)
+	}
+	if got := resolveTrace(c, spanID, "X-Request-Id"); got != "bbbbbbbbbbbbbbbb" {
+		t.Errorf("span-id = %q, want traceparent's span id", got)
+	}
+}
+
+func TestResolveTraceFallsBackToTraceHeader(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "fallback-id")
+	c := &elton.Context{Request: req}
+
+	if got := resolveTrace(c, traceID, "X-Request-Id"); got != "fallback-id" {
+		t.Errorf("trace-id = %q, want traceHeader fallback %q", got, "fallback-id")
+	}
+	if got := resolveTrace(c, spanID, "X-Request-Id"); got != "" {
+		t.Errorf("span-id = %q, want empty (traceHeader only supplies trace-id)", got)
+	}
+}